@@ -27,12 +27,12 @@ import re
 import subprocess
 from .overlay import BindMount
 from .overlay import BindOverlay
+from .overlay import DEFAULT_OVERLAYS_DIR
 
 _DEFAULT_META_ANDROID_DIR = 'LINUX/android'
 _DEFAULT_COMMAND = '/bin/bash'
 
 _SOURCE_MOUNT_POINT = '/src'
-_OUT_MOUNT_POINT = '/src/out'
 _DIST_MOUNT_POINT = '/dist'
 _META_MOUNT_POINT = '/meta'
 
@@ -82,8 +82,10 @@ def run(command,
         nsjail_bin,
         chroot,
         overlay_config=None,
+        overlays_dir=DEFAULT_OVERLAYS_DIR,
         rw_whitelist_config=None,
         source_dir=os.getcwd(),
+        source_mount_point=_SOURCE_MOUNT_POINT,
         out_dirname_for_whiteout=None,
         dist_dir=None,
         build_id=None,
@@ -109,8 +111,13 @@ def run(command,
     nsjail_bin: A string with the path to the nsjail binary.
     chroot: A string with the path to the chroot.
     overlay_config: A string path to an overlay configuration file.
+    overlays_dir: A string with the path to the directory containing all
+      overlays, relative to source_dir.
     rw_whitelist_config: A string path to a read/write whitelist configuration file.
     source_dir: A string with the path to the Android platform source.
+    source_mount_point: A string with the path inside the jail where the
+      Android platform source is mounted. It is also the initial working
+      directory.
     out_dirname_for_whiteout: The optional name of the folder within
       source_dir that is the Android build out folder *as seen from outside
       the Docker container*.
@@ -147,8 +154,10 @@ def run(command,
       nsjail_bin=nsjail_bin,
       chroot=chroot,
       overlay_config=overlay_config,
+      overlays_dir=overlays_dir,
       rw_whitelist_config=rw_whitelist_config,
       source_dir=source_dir,
+      source_mount_point=source_mount_point,
       out_dirname_for_whiteout=out_dirname_for_whiteout,
       dist_dir=dist_dir,
       build_id=build_id,
@@ -178,8 +187,10 @@ def get_command(command,
         nsjail_bin,
         chroot,
         overlay_config=None,
+        overlays_dir=DEFAULT_OVERLAYS_DIR,
         rw_whitelist_config=None,
         source_dir=os.getcwd(),
+        source_mount_point=_SOURCE_MOUNT_POINT,
         out_dirname_for_whiteout=None,
         dist_dir=None,
         build_id=None,
@@ -202,8 +213,13 @@ def get_command(command,
     nsjail_bin: A string with the path to the nsjail binary.
     chroot: A string with the path to the chroot.
     overlay_config: A string path to an overlay configuration file.
+    overlays_dir: A string with the path to the directory containing all
+      overlays, relative to source_dir.
     rw_whitelist_config: A string path to a read/write whitelist configuration file.
     source_dir: A string with the path to the Android platform source.
+    source_mount_point: A string with the path inside the jail where the
+      Android platform source is mounted. It is also the initial working
+      directory.
     out_dirname_for_whiteout: The optional name of the folder within
       source_dir that is the Android build out folder *as seen from outside
       the Docker container*.
@@ -269,6 +285,8 @@ def get_command(command,
     nsjail_command.append('--max_cpus=%i' % max_cpus)
   if quiet:
     nsjail_command.append('--quiet')
+  if source_mount_point != _SOURCE_MOUNT_POINT:
+    nsjail_command.extend(['--cwd', source_mount_point])
 
   whiteout_list = set()
   if out_dirname_for_whiteout:
@@ -289,15 +307,17 @@ def get_command(command,
                       source_dir,
                       overlay_config,
                       whiteout_list,
-                      _SOURCE_MOUNT_POINT,
-                      rw_whitelist)
+                      source_mount_point,
+                      rw_whitelist,
+                      overlays_dir)
     bind_mounts = overlay.GetBindMounts()
   else:
     bind_mounts = collections.OrderedDict()
-    bind_mounts[_SOURCE_MOUNT_POINT] = BindMount(source_dir, False)
+    bind_mounts[source_mount_point] = BindMount(source_dir, False)
 
   if out_dir:
-    bind_mounts[_OUT_MOUNT_POINT] = BindMount(out_dir, False)
+    bind_mounts[os.path.join(source_mount_point, 'out')] = BindMount(
+        out_dir, False)
 
   if dist_dir:
     bind_mounts[_DIST_MOUNT_POINT] = BindMount(dist_dir, False)
@@ -410,13 +430,24 @@ def parse_args():
   parser.add_argument(
       '--overlay_config',
       help='Path to the overlay configuration file.')
+  parser.add_argument(
+      '--overlays_dir',
+      default=DEFAULT_OVERLAYS_DIR,
+      help='Path to the directory containing all overlays. This path must be '
+      'relative to source_dir. Defaults to \'%s\'' % DEFAULT_OVERLAYS_DIR)
   parser.add_argument(
       '--rw_whitelist_config',
       help='Path to the read/write whitelist configuration file.')
   parser.add_argument(
       '--source_dir',
       default=os.getcwd(),
-      help='Path to Android platform source to be mounted as /src.')
+      help='Path to Android platform source to be mounted as '
+      'source_mount_point.')
+  parser.add_argument(
+      '--source_mount_point',
+      default=_SOURCE_MOUNT_POINT,
+      help='Path inside the NsJail sandbox where the Android platform source '
+      'is mounted. Defaults to \'%s\'' % _SOURCE_MOUNT_POINT)
   parser.add_argument(
       '--out_dir',
       help='Full path to the Android build out folder. If not provided, uses '
@@ -518,8 +549,10 @@ def run_with_args(args):
   run(chroot=args.chroot,
       nsjail_bin=args.nsjail_bin,
       overlay_config=args.overlay_config,
+      overlays_dir=args.overlays_dir,
       rw_whitelist_config=args.rw_whitelist_config,
       source_dir=args.source_dir,
+      source_mount_point=args.source_mount_point,
       command=args.command.split(),
       android_target=args.android_target,
       out_dirname_for_whiteout=args.out_dirname_for_whiteout,
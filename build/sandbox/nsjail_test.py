@@ -147,6 +147,29 @@ class NsjailTest(unittest.TestCase):
         ]
     )
 
+  def testSourceMountPoint(self):
+    commands = nsjail.run(
+        nsjail_bin='/bin/true',
+        chroot='/chroot',
+        source_dir='/source_dir',
+        source_mount_point='/workspace',
+        command=['/bin/bash'],
+        android_target='target_name',
+        out_dir='/out_dir',
+        dry_run=True)
+    self.assertEqual(
+        commands,
+        [
+            '/bin/true',
+            '--env', 'USER=nobody',
+            '--config', '/nsjail.cfg',
+            '--cwd', '/workspace',
+            '--bindmount', '/source_dir:/workspace',
+            '--bindmount', '/out_dir:/workspace/out',
+            '--', '/bin/bash'
+        ]
+    )
+
   def testEnv(self):
     commands = nsjail.run(
         nsjail_bin='/bin/true',
@@ -30,6 +30,8 @@ import xml.etree.ElementTree as ET
 
 BindMount = collections.namedtuple('BindMount', ['source_dir', 'readonly'])
 
+DEFAULT_OVERLAYS_DIR = 'overlays'
+
 
 class BindOverlay(object):
   """Manages filesystem overlays of Android source tree using bind mounts.
@@ -209,7 +211,7 @@ class BindOverlay(object):
     return skip_subdirs
 
   def _AddOverlays(self, source_dir, overlay_dirs, destination_dir,
-                   skip_subdirs, rw_whitelist):
+                   skip_subdirs, rw_whitelist, overlays_dir):
     """Add the selected overlay directories.
 
     Args:
@@ -221,6 +223,8 @@ class BindOverlay(object):
       skip_subdirs: A set of string paths to be skipped from overlays.
       rw_whitelist: An optional set of source paths to bind mount with
         read/write access.
+      overlays_dir: A string with the path to the directory containing all
+        overlays, relative to source_dir.
     """
 
     # Create empty intermediate workdir
@@ -240,7 +244,7 @@ class BindOverlay(object):
     # The results of attempting to overlay two git projects on top
     # of each other are unpredictable and may push the limits of bind mounts.
 
-    skip_subdirs.add(os.path.join(source_dir, 'overlays'))
+    skip_subdirs.add(os.path.join(source_dir, overlays_dir))
 
     for overlay_dir in overlay_dirs:
       self._AddOverlay(overlay_dir, intermediate_work_dir,
@@ -301,7 +305,8 @@ class BindOverlay(object):
                config_file,
                whiteout_list = [],
                destination_dir=None,
-               rw_whitelist=None):
+               rw_whitelist=None,
+               overlays_dir=DEFAULT_OVERLAYS_DIR):
     """Inits Overlay with the details of what is going to be overlaid.
 
     Args:
@@ -316,6 +321,8 @@ class BindOverlay(object):
         read/write access. If none is provided, all paths will be mounted with
         read/write access. If the set is empty, all paths will be mounted
         read-only.
+      overlays_dir: A string with the path to the directory containing all
+        overlays, relative to source_dir.
     """
 
     if not destination_dir:
@@ -338,11 +345,12 @@ class BindOverlay(object):
     overlay_dirs = []
     overlay_map = get_overlay_map(config_file)
     for overlay_dir in overlay_map[target]:
-      overlay_dir = os.path.join(source_dir, 'overlays', overlay_dir)
+      overlay_dir = os.path.join(source_dir, overlays_dir, overlay_dir)
       overlay_dirs.append(overlay_dir)
 
     self._AddOverlays(
-        source_dir, overlay_dirs, destination_dir, skip_subdirs, rw_whitelist)
+        source_dir, overlay_dirs, destination_dir, skip_subdirs, rw_whitelist,
+        overlays_dir)
 
     # If specified for this target, create a custom filesystem view
     fs_view_map = get_fs_view_map(config_file)
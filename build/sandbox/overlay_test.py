@@ -99,6 +99,40 @@ class BindOverlayTest(unittest.TestCase):
     bind_destination = os.path.join(self.source_dir, 'from_dir')
     self.assertEqual(bind_mounts[bind_destination], overlay.BindMount(bind_source, False))
 
+  def testCustomOverlaysDir(self):
+    os.rename(os.path.join(self.source_dir, 'overlays'),
+              os.path.join(self.source_dir, 'device_overlays'))
+    with tempfile.NamedTemporaryFile('w+t') as test_config:
+      test_config.write(
+        '<?xml version="1.0" encoding="UTF-8" ?>'
+        '<config>'
+        '  <target name="unittest">'
+        '    <overlay name="unittest1"/>'
+        '  </target>'
+        '</config>'
+        )
+      test_config.flush()
+      o = overlay.BindOverlay(
+          config_file=test_config.name,
+          target='unittest',
+          source_dir=self.source_dir,
+          destination_dir=self.destination_dir,
+          overlays_dir='device_overlays')
+    self.assertIsNotNone(o)
+    bind_mounts = o.GetBindMounts()
+    bind_source = os.path.join(self.source_dir,
+                               'device_overlays/unittest1/from_dir')
+    bind_destination = os.path.join(self.destination_dir, 'from_dir')
+    self.assertEqual(bind_mounts[bind_destination], overlay.BindMount(bind_source, False))
+    # The custom overlays directory itself must be skipped, so nothing in it
+    # is bind mounted into the destination.
+    overlays_destination = os.path.join(self.destination_dir,
+                                        'device_overlays')
+    self.assertNotIn(overlays_destination, bind_mounts)
+    self.assertEqual(
+        [d for d in bind_mounts
+         if d.startswith(overlays_destination + os.sep)], [])
+
   def testMultipleOverlays(self):
     with tempfile.NamedTemporaryFile('w+t') as test_config:
       test_config.write(
@@ -20,17 +20,21 @@ targets: Space-separated list of targets that should be buildable
 
 options:
   --manifest <path>
-      Path to the repo manifest to split. [Required]
+      Path to the repo manifest to split. If not provided, the manifest of the
+      repo checkout containing the current directory is used.
   --split-manifest <path>
       Path to write the resulting split manifest. [Required]
   --config <path>
       Optional path(s) to a config XML file containing projects to add or
-      remove. See default_config.xml for an example. This flag can be passed
-      more than once to use multiple config files.
+      remove, and rules to remap input paths before finding their project
+      (e.g. paths recorded inside a build sandbox). See default_config.xml for
+      an example. This flag can be passed more than once to use multiple
+      config files.
         Sample file my_config.xml:
           <config>
             <add_project name="vendor/my/needed/project" />
             <remove_project name="vendor/my/unused/project" />
+            <path_mapping pattern="^/src/" sub="" />
           </config>
   --repo-list <path>
       Optional path to the output of the 'repo list' command. Used if the
@@ -59,12 +63,14 @@ options:
 
 from __future__ import print_function
 
+import collections
 import getopt
 import hashlib
 import json
 import logging
 import os
 import pkg_resources
+import re
 import subprocess
 import sys
 import xml.etree.ElementTree as ET
@@ -81,6 +87,8 @@ logger = logging.getLogger(os.path.basename(__file__))
 DEFAULT_CONFIG_PATH = pkg_resources.resource_filename(__name__,
                                                       "default_config.xml")
 
+PathMapping = collections.namedtuple("PathMapping", ["pattern", "sub"])
+
 
 def read_config(config_file):
   """Reads a config XML file to find extra projects to add or remove.
@@ -89,14 +97,81 @@ def read_config(config_file):
     config_file: The filename of the config XML.
 
   Returns:
-    A tuple of (set of remove_projects, set of add_projects) from the config.
+    A tuple of (set of remove_projects, set of add_projects, list of
+    path_mappings) from the config.
   """
   root = ET.parse(config_file).getroot()
   remove_projects = set(
       [child.attrib["name"] for child in root.findall("remove_project")])
   add_projects = set(
       [child.attrib["name"] for child in root.findall("add_project")])
-  return remove_projects, add_projects
+  path_mappings = [
+      PathMapping(re.compile(child.attrib["pattern"]), child.attrib["sub"])
+      for child in root.findall("path_mapping")
+  ]
+  return remove_projects, add_projects, path_mappings
+
+
+def find_repo_manifest(start_dir):
+  """Returns the path to the manifest of the repo checkout containing a dir.
+
+  Searches start_dir and each of its parent directories for a .repo directory.
+
+  Args:
+    start_dir: The directory to start searching from.
+
+  Returns:
+    The path string of the .repo/manifest.xml file, or None if not found.
+  """
+  current_dir = os.path.abspath(start_dir)
+  while True:
+    manifest_file = os.path.join(current_dir, ".repo", "manifest.xml")
+    if os.path.exists(manifest_file):
+      return manifest_file
+    parent_dir = os.path.dirname(current_dir)
+    if parent_dir == current_dir:
+      return None
+    current_dir = parent_dir
+
+
+def read_manifest(manifest_file, include_dir=None):
+  """Reads a manifest XML file, expanding any <include> elements in place.
+
+  Like repo, all included manifests, including nested ones, are found relative
+  to the directory of the top-level manifest. For .repo/manifest.xml that is
+  the .repo/manifests project. The groups and revision attributes of an
+  <include> are applied to the projects it includes, as repo does.
+
+  Args:
+    manifest_file: The filename of the manifest XML.
+    include_dir: The directory to find included manifests in. Defaults to the
+      directory of manifest_file.
+
+  Returns:
+    The manifest ElementTree.
+  """
+  manifest = ET.parse(manifest_file)
+  if include_dir is None:
+    include_dir = os.path.dirname(os.path.realpath(manifest_file))
+    if os.path.basename(include_dir) == ".repo":
+      include_dir = os.path.join(include_dir, "manifests")
+
+  root = manifest.getroot()
+  for include in root.findall("include"):
+    index = list(root).index(include)
+    root.remove(include)
+    included_root = read_manifest(
+        os.path.join(include_dir, include.attrib["name"]),
+        include_dir).getroot()
+    for offset, child in enumerate(included_root):
+      if child.tag == "project":
+        if "groups" in include.attrib:
+          groups = [child.get("groups"), include.attrib["groups"]]
+          child.set("groups", ",".join(g for g in groups if g))
+        if "revision" in include.attrib and "revision" not in child.attrib:
+          child.set("revision", include.attrib["revision"])
+      root.insert(index + offset, child)
+  return manifest
 
 
 def get_repo_projects(repo_list_file):
@@ -256,6 +331,61 @@ def get_kati_makefiles(kati_stamp_file, overlays):
   return makefiles_and_symlinks
 
 
+def get_file_mappings(manifest):
+  """Returns a dict of { destination path : source path } for manifest files.
+
+  Repo places the sources of <copyfile> and <linkfile> elements at their
+  destination paths, which are usually outside of any project. Build inputs
+  found at a destination path belong to the project containing the source.
+
+  Args:
+    manifest: The manifest ElementTree to read copyfile and linkfile elements
+      from.
+  """
+  file_mappings = {}
+  for project in manifest.getroot().findall("project"):
+    project_path = project.get("path", project.attrib["name"])
+    for child in project.findall("copyfile") + project.findall("linkfile"):
+      file_mappings[os.path.normpath(child.attrib["dest"])] = os.path.join(
+          project_path, os.path.normpath(child.attrib["src"]))
+  return file_mappings
+
+
+def map_input_path(file_mappings, input_path):
+  """Returns the input path with any copyfile or linkfile destination replaced.
+
+  Args:
+    file_mappings: The output of the get_file_mappings function.
+    input_path: The path of an input file used in the build, as given by the
+      ninja inputs tool.
+  """
+  parts = input_path.split("/")
+
+  # A linkfile may point to a directory, so also check each parent directory.
+  for index in reversed(range(0, len(parts))):
+    dest = os.path.join(*parts[:index + 1])
+    if dest in file_mappings:
+      return os.path.join(file_mappings[dest], *parts[index + 1:])
+
+  return input_path
+
+
+def remap_path(path_mappings, input_path):
+  """Returns the input path rewritten by the first matching path mapping.
+
+  Args:
+    path_mappings: A list of PathMapping rules from the config files.
+    input_path: The path of an input file used in the build, as given by the
+      ninja inputs tool.
+  """
+  for path_mapping in path_mappings:
+    mapped_path, count = path_mapping.pattern.subn(path_mapping.sub,
+                                                   input_path, 1)
+    if count:
+      return mapped_path
+  return input_path
+
+
 def scan_repo_projects(repo_projects, input_path):
   """Returns the project path of the given input path if it exists.
 
@@ -277,17 +407,25 @@ def scan_repo_projects(repo_projects, input_path):
   return None
 
 
-def get_input_projects(repo_projects, inputs):
+def get_input_projects(repo_projects, inputs, file_mappings=None,
+                       path_mappings=None):
   """Returns the set of project names that contain the given input paths.
 
   Args:
     repo_projects: The output of the get_repo_projects function.
     inputs: The paths of input files used in the build, as given by the ninja
       inputs tool.
+    file_mappings: The optional output of the get_file_mappings function.
+    path_mappings: An optional list of PathMapping rules applied to each input
+      path before finding its project.
   """
+  file_mappings = file_mappings or {}
+  path_mappings = path_mappings or []
+  input_paths = [remap_path(path_mappings, input_path) for input_path in inputs]
   input_project_paths = [
-      scan_repo_projects(repo_projects, input_path)
-      for input_path in inputs
+      scan_repo_projects(repo_projects,
+                         map_input_path(file_mappings, input_path))
+      for input_path in input_paths
       if (not input_path.startswith("out/") and not input_path.startswith("/"))
   ]
   return {
@@ -314,6 +452,19 @@ def update_manifest(manifest, input_projects, remove_projects):
   for child in root.findall("project"):
     if child.attrib["name"] not in projects_to_keep:
       root.remove(child)
+  # Repo rejects <remove-project> and <extend-project> elements that refer to
+  # a project missing from the manifest, so drop those for removed projects.
+  # Both elements may refer to a project by name, by path, or by both.
+  paths_to_keep = {
+      child.get("path", child.attrib["name"])
+      for child in root.findall("project")
+  }
+  for child in root.findall("remove-project") + root.findall("extend-project"):
+    if ("name" in child.attrib and
+        child.attrib["name"] not in projects_to_keep) or (
+            "path" in child.attrib and
+            child.attrib["path"] not in paths_to_keep):
+      root.remove(child)
   return manifest
 
 
@@ -359,16 +510,23 @@ def create_split_manifest(targets, manifest_file, split_manifest_file,
   """
   remove_projects = set()
   add_projects = set()
+  path_mappings = []
   for config_file in config_files:
-    config_remove_projects, config_add_projects = read_config(config_file)
+    (config_remove_projects, config_add_projects,
+     config_path_mappings) = read_config(config_file)
     remove_projects = remove_projects.union(config_remove_projects)
     add_projects = add_projects.union(config_add_projects)
+    path_mappings.extend(config_path_mappings)
+
+  original_manifest = read_manifest(manifest_file)
+  file_mappings = get_file_mappings(original_manifest)
 
   repo_projects = get_repo_projects(repo_list_file)
   module_info = get_module_info(module_info_file, repo_projects)
 
   inputs = get_ninja_inputs(ninja_binary, ninja_build_file, targets)
-  input_projects = get_input_projects(repo_projects, inputs)
+  input_projects = get_input_projects(repo_projects, inputs, file_mappings,
+                                      path_mappings)
   if logger.isEnabledFor(logging.DEBUG):
     for project in sorted(input_projects):
       logger.debug("Direct dependency: %s", project)
@@ -376,7 +534,8 @@ def create_split_manifest(targets, manifest_file, split_manifest_file,
               " ".join(targets))
 
   kati_makefiles = get_kati_makefiles(kati_stamp_file, overlays)
-  kati_makefiles_projects = get_input_projects(repo_projects, kati_makefiles)
+  kati_makefiles_projects = get_input_projects(repo_projects, kati_makefiles,
+                                               file_mappings, path_mappings)
   if logger.isEnabledFor(logging.DEBUG):
     for project in sorted(kati_makefiles_projects.difference(input_projects)):
       logger.debug("Kati makefile dependency: %s", project)
@@ -411,7 +570,9 @@ def create_split_manifest(targets, manifest_file, split_manifest_file,
 
     # adding those modules' input projects to our list of projects.
     inputs = get_ninja_inputs(ninja_binary, ninja_build_file, modules)
-    adjacent_module_additions = get_input_projects(repo_projects, inputs)
+    adjacent_module_additions = get_input_projects(repo_projects, inputs,
+                                                   file_mappings,
+                                                   path_mappings)
     if logger.isEnabledFor(logging.DEBUG):
       for project in sorted(
           adjacent_module_additions.difference(input_projects)):
@@ -421,7 +582,6 @@ def create_split_manifest(targets, manifest_file, split_manifest_file,
 
     projects_to_check = input_projects.difference(checked_projects)
 
-  original_manifest = ET.parse(manifest_file)
   original_sha1 = create_manifest_sha1_element(original_manifest, "original")
   split_manifest = update_manifest(original_manifest, input_projects,
                                    remove_projects)
@@ -492,6 +652,10 @@ def main(argv):
     print(__doc__, file=sys.stderr)
     print("**Missing targets**", file=sys.stderr)
     sys.exit(2)
+  if not manifest_file:
+    manifest_file = find_repo_manifest(os.getcwd())
+    if manifest_file:
+      logger.info("Using manifest %s", manifest_file)
   if not manifest_file:
     print(__doc__, file=sys.stderr)
     print("**Missing required flag --manifest**", file=sys.stderr)
@@ -16,6 +16,7 @@
 import hashlib
 import mock
 import os
+import re
 import subprocess
 import tempfile
 import unittest
@@ -34,12 +35,123 @@ class ManifestSplitTest(unittest.TestCase):
           <add_project name="add2" />
           <remove_project name="remove1" />
           <remove_project name="remove2" />
+          <path_mapping pattern="^/src/" sub="" />
         </config>""")
       test_config.flush()
-      remove_projects, add_projects = manifest_split.read_config(
-          test_config.name)
+      remove_projects, add_projects, path_mappings = (
+          manifest_split.read_config(test_config.name))
       self.assertEqual(remove_projects, set(['remove1', 'remove2']))
       self.assertEqual(add_projects, set(['add1', 'add2']))
+      self.assertEqual(path_mappings, [
+          manifest_split.PathMapping(re.compile('^/src/'), ''),
+      ])
+
+  def test_find_repo_manifest(self):
+    with tempfile.TemporaryDirectory() as temp_dir:
+      manifest_file = os.path.join(temp_dir, '.repo', 'manifest.xml')
+      os.makedirs(os.path.dirname(manifest_file))
+      os.mknod(manifest_file)
+      project_dir = os.path.join(temp_dir, 'system', 'project1')
+      os.makedirs(project_dir)
+
+      self.assertEqual(
+          manifest_split.find_repo_manifest(project_dir), manifest_file)
+      self.assertEqual(
+          manifest_split.find_repo_manifest(temp_dir), manifest_file)
+
+  def test_find_repo_manifest_not_found(self):
+    with tempfile.TemporaryDirectory() as temp_dir:
+      self.assertIsNone(manifest_split.find_repo_manifest(temp_dir))
+
+  def test_read_manifest(self):
+    with tempfile.TemporaryDirectory() as temp_dir:
+      repo_dir = os.path.join(temp_dir, '.repo')
+      os.makedirs(os.path.join(repo_dir, 'manifests'))
+      with open(os.path.join(repo_dir, 'manifest.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <include name="default.xml" />
+          </manifest>""")
+      with open(os.path.join(repo_dir, 'manifests', 'default.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <remote name="aosp" fetch=".." />
+            <include name="projects.xml" />
+            <project name="platform/project2" path="system/project2" />
+          </manifest>""")
+      with open(os.path.join(repo_dir, 'manifests', 'projects.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <project name="platform/project1" path="system/project1" />
+          </manifest>""")
+
+      manifest = manifest_split.read_manifest(
+          os.path.join(repo_dir, 'manifest.xml'))
+      self.assertEqual([
+          (child.tag, child.attrib['name']) for child in manifest.getroot()
+      ], [
+          ('remote', 'aosp'),
+          ('project', 'platform/project1'),
+          ('project', 'platform/project2'),
+      ])
+
+  def test_read_manifest_nested_include(self):
+    with tempfile.TemporaryDirectory() as temp_dir:
+      manifests_dir = os.path.join(temp_dir, '.repo', 'manifests')
+      os.makedirs(os.path.join(manifests_dir, 'vendor'))
+      with open(os.path.join(temp_dir, '.repo', 'manifest.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <include name="default.xml" />
+          </manifest>""")
+      with open(os.path.join(manifests_dir, 'default.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <include name="vendor/a.xml" />
+          </manifest>""")
+      with open(os.path.join(manifests_dir, 'vendor', 'a.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <project name="vendor/project_a" />
+            <include name="vendor/b.xml" />
+          </manifest>""")
+      with open(os.path.join(manifests_dir, 'vendor', 'b.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <project name="vendor/project_b" />
+          </manifest>""")
+
+      manifest = manifest_split.read_manifest(
+          os.path.join(temp_dir, '.repo', 'manifest.xml'))
+      self.assertEqual(
+          [child.attrib['name'] for child in manifest.getroot()],
+          ['vendor/project_a', 'vendor/project_b'])
+
+  def test_read_manifest_include_attributes(self):
+    with tempfile.TemporaryDirectory() as temp_dir:
+      with open(os.path.join(temp_dir, 'default.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <include name="vendor.xml" groups="vendor" revision="branch1" />
+          </manifest>""")
+      with open(os.path.join(temp_dir, 'vendor.xml'), 'w') as f:
+        f.write("""
+          <manifest>
+            <remote name="partner" fetch=".." />
+            <project name="vendor/project1" />
+            <project name="vendor/project2" groups="pdk" revision="branch2" />
+          </manifest>""")
+
+      manifest = manifest_split.read_manifest(
+          os.path.join(temp_dir, 'default.xml'))
+      self.assertEqual([
+          (child.get('name'), child.get('groups'), child.get('revision'))
+          for child in manifest.getroot()
+      ], [
+          ('partner', None, None),
+          ('vendor/project1', 'vendor', 'branch1'),
+          ('vendor/project2', 'pdk,vendor', 'branch2'),
+      ])
 
   def test_get_repo_projects(self):
     with tempfile.NamedTemporaryFile('w+t') as repo_list_file:
@@ -132,6 +244,61 @@ class ManifestSplitTest(unittest.TestCase):
               'vendor/oem4/symlink_src.mk',
           ]))
 
+  def test_get_file_mappings(self):
+    manifest_contents = """
+      <manifest>
+        <project name="platform/build/soong" path="build/soong">
+          <linkfile src="root.bp" dest="Android.bp" />
+          <linkfile src="scripts" dest="build/scripts" />
+        </project>
+        <project name="platform/build">
+          <copyfile src="core/root.mk" dest="Makefile" />
+        </project>
+        <project name="platform/project1" path="system/project1" />
+      </manifest>"""
+    self.assertEqual(
+        manifest_split.get_file_mappings(
+            ET.ElementTree(ET.fromstring(manifest_contents))), {
+                'Android.bp': 'build/soong/root.bp',
+                'build/scripts': 'build/soong/scripts',
+                'Makefile': 'platform/build/core/root.mk',
+            })
+
+  def test_map_input_path(self):
+    file_mappings = {
+        'Android.bp': 'build/soong/root.bp',
+        'build/scripts': 'build/soong/scripts',
+    }
+    self.assertEqual(
+        manifest_split.map_input_path(file_mappings, 'Android.bp'),
+        'build/soong/root.bp')
+    self.assertEqual(
+        manifest_split.map_input_path(file_mappings, 'build/scripts/a/b.py'),
+        'build/soong/scripts/a/b.py')
+    self.assertEqual(
+        manifest_split.map_input_path(file_mappings,
+                                      'system/project1/Android.bp'),
+        'system/project1/Android.bp')
+
+  def test_remap_path(self):
+    path_mappings = [
+        manifest_split.PathMapping(re.compile('^/src/'), ''),
+        manifest_split.PathMapping(re.compile('^/(src|meta)/'), 'other/'),
+        manifest_split.PathMapping(
+            re.compile('^external/(.*)/src/'), r'external/\1/'),
+    ]
+    self.assertEqual(
+        manifest_split.remap_path(path_mappings, '/src/system/project1/a.h'),
+        'system/project1/a.h')
+    self.assertEqual(
+        manifest_split.remap_path(path_mappings, '/meta/b.h'), 'other/b.h')
+    self.assertEqual(
+        manifest_split.remap_path(path_mappings, 'external/foo/src/c.cc'),
+        'external/foo/c.cc')
+    self.assertEqual(
+        manifest_split.remap_path(path_mappings, 'system/project1/a.h'),
+        'system/project1/a.h')
+
   def test_scan_repo_projects(self):
     repo_projects = {
         'system/project1': 'platform/project1',
@@ -166,6 +333,40 @@ class ManifestSplitTest(unittest.TestCase):
         manifest_split.get_input_projects(repo_projects, inputs),
         set(['platform/project1', 'platform/project2']))
 
+  def test_get_input_projects_with_file_mappings(self):
+    repo_projects = {
+        'build/soong': 'platform/build/soong',
+        'system/project1': 'platform/project1',
+    }
+    inputs = [
+        'Android.bp',
+        'system/project1/path/to/file.h',
+        'unmapped_root_file',
+    ]
+    file_mappings = {
+        'Android.bp': 'build/soong/root.bp',
+    }
+    self.assertEqual(
+        manifest_split.get_input_projects(repo_projects, inputs,
+                                          file_mappings),
+        set(['platform/build/soong', 'platform/project1']))
+
+  def test_get_input_projects_with_path_mappings(self):
+    repo_projects = {
+        'system/project1': 'platform/project1',
+    }
+    inputs = [
+        '/src/system/project1/path/to/file.h',
+        '/src/out/path/to/out/file.h',
+    ]
+    path_mappings = [
+        manifest_split.PathMapping(re.compile('^/src/'), ''),
+    ]
+    self.assertEqual(
+        manifest_split.get_input_projects(
+            repo_projects, inputs, path_mappings=path_mappings),
+        set(['platform/project1']))
+
   def test_update_manifest(self):
     manifest_contents = """
       <manifest>
@@ -185,6 +386,59 @@ class ManifestSplitTest(unittest.TestCase):
         ET.tostring(projects[0]).strip().decode(),
         '<project name="platform/project1" path="system/project1" />')
 
+  def test_update_manifest_remove_and_extend_project(self):
+    manifest_contents = """
+      <manifest>
+        <project name="platform/project1" path="system/project1" />
+        <project name="platform/project2" path="system/project2" />
+        <project name="platform/project3" path="system/project3" />
+        <remove-project name="platform/project1" />
+        <remove-project name="platform/project3" />
+        <project name="platform/project1" path="system/project1" />
+        <extend-project name="platform/project1" groups="group1" />
+        <extend-project name="platform/project2" groups="group2" />
+      </manifest>"""
+    input_projects = set(['platform/project1', 'platform/project2'])
+    remove_projects = set(['platform/project2'])
+    manifest = manifest_split.update_manifest(
+        ET.ElementTree(ET.fromstring(manifest_contents)), input_projects,
+        remove_projects)
+
+    self.assertEqual([
+        (child.tag, child.attrib['name']) for child in manifest.getroot()
+    ], [
+        ('project', 'platform/project1'),
+        ('remove-project', 'platform/project1'),
+        ('project', 'platform/project1'),
+        ('extend-project', 'platform/project1'),
+    ])
+
+  def test_update_manifest_remove_project_by_path(self):
+    manifest_contents = """
+      <manifest>
+        <project name="platform/project1" path="system/project1" />
+        <project name="platform/project2" path="system/project2" />
+        <remove-project path="system/project1" />
+        <remove-project path="system/project2" />
+        <project name="platform/project1" path="system/project1" />
+        <extend-project name="platform/project1" path="system/project1" />
+        <extend-project name="platform/project2" path="system/project2" />
+      </manifest>"""
+    input_projects = set(['platform/project1'])
+    manifest = manifest_split.update_manifest(
+        ET.ElementTree(ET.fromstring(manifest_contents)), input_projects,
+        set())
+
+    self.assertEqual([
+        (child.tag, child.get('name'), child.get('path'))
+        for child in manifest.getroot()
+    ], [
+        ('project', 'platform/project1', 'system/project1'),
+        ('remove-project', None, 'system/project1'),
+        ('project', 'platform/project1', 'system/project1'),
+        ('extend-project', 'platform/project1', 'system/project1'),
+    ])
+
   def test_create_manifest_sha1_element(self):
     manifest = ET.ElementTree(ET.fromstring('<manifest></manifest>'))
     manifest_sha1 = hashlib.sha1(ET.tostring(manifest.getroot())).hexdigest()